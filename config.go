@@ -0,0 +1,90 @@
+package sarama
+
+import "time"
+
+// Config holds the tunables shared by the Client and the producers/consumers built from it. Use
+// NewConfig to obtain one with sane defaults rather than constructing it directly.
+type Config struct {
+	// ChannelBufferSize is the number of events to buffer in internal and external channels. This
+	// permits the producer and consumer to continue processing some messages in the background
+	// while user code is working, greatly improving throughput. Defaults to 256.
+	ChannelBufferSize int
+
+	Metadata struct {
+		Retry struct {
+			// Max is the total number of times to retry a metadata request when the cluster
+			// is in the middle of a leader election. Defaults to 3.
+			Max int
+
+			// Backoff is how long to wait between metadata retries. Defaults to 250ms.
+			Backoff time.Duration
+		}
+	}
+
+	Consumer struct {
+		Return struct {
+			// Errors, if enabled, causes consumers to push errors onto the Errors channel
+			// instead of just logging them and moving on. Defaults to false, for backwards
+			// compatibility.
+			Errors bool
+		}
+
+		// Offsets configures how consumer offsets are fetched, committed, and retained.
+		Offsets struct {
+			// Initial is the offset to use if no committed offset is found for a partition,
+			// either OffsetNewest or OffsetOldest. Defaults to OffsetOldest.
+			Initial int64
+
+			// CommitInterval is how frequently an OffsetManager commits updated offsets to
+			// the group coordinator, absent a call to OffsetManager.CommitOffsets. Defaults
+			// to 1s.
+			CommitInterval time.Duration
+
+			// Retention is the duration the broker retains committed offsets for. A value of
+			// 0 (the default) leaves the broker's own offsets.retention.minutes in effect.
+			Retention time.Duration
+		}
+
+		// Group configures the JoinGroup/SyncGroup/Heartbeat membership protocol driven by
+		// ConsumerGroup.
+		Group struct {
+			Session struct {
+				// Timeout is the allowed gap, reported to the coordinator in JoinGroup,
+				// between heartbeats before this member is kicked out of the group.
+				// Defaults to 10s.
+				Timeout time.Duration
+			}
+
+			Heartbeat struct {
+				// Interval is how frequently to send heartbeats to the group coordinator.
+				// It must be lower than Session.Timeout. Defaults to 3s.
+				Interval time.Duration
+			}
+
+			Rebalance struct {
+				// Strategy selects how partitions are assigned across group members.
+				// Defaults to BalanceStrategyRange.
+				Strategy BalanceStrategy
+			}
+		}
+	}
+}
+
+// NewConfig returns a new configuration instance with sane defaults.
+func NewConfig() *Config {
+	c := &Config{}
+
+	c.ChannelBufferSize = 256
+
+	c.Metadata.Retry.Max = 3
+	c.Metadata.Retry.Backoff = 250 * time.Millisecond
+
+	c.Consumer.Offsets.Initial = OffsetOldest
+	c.Consumer.Offsets.CommitInterval = 1 * time.Second
+
+	c.Consumer.Group.Session.Timeout = 10 * time.Second
+	c.Consumer.Group.Heartbeat.Interval = 3 * time.Second
+	c.Consumer.Group.Rebalance.Strategy = BalanceStrategyRange
+
+	return c
+}
@@ -0,0 +1,563 @@
+package sarama
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosedConsumerGroup is the error returned when a method is called on a consumer group that
+// has already been closed.
+var ErrClosedConsumerGroup = errors.New("kafka: tried to use a consumer group that was closed")
+
+// ConsumerGroup coordinates processing of a topic by a group of consumer processes, handing each
+// process a fair, non-overlapping share of the partitions via Kafka's group membership protocol
+// (JoinGroup/SyncGroup/Heartbeat/LeaveGroup).
+type ConsumerGroup interface {
+	// Consume joins the group, waits for a partition assignment, and drives handler against the
+	// claimed partitions until the session is invalidated by a rebalance or ctx is cancelled.
+	// Callers are expected to call Consume in a loop, since every rebalance ends the current
+	// session.
+	Consume(ctx context.Context, topics []string, handler ConsumerGroupHandler) error
+
+	// Errors returns a channel of errors that occurred during the consumer life-cycle, if
+	// Config.Consumer.Return.Errors is enabled.
+	Errors() <-chan error
+
+	// Close stops the ConsumerGroup, closing its Consumer and its Errors channel. It does not send
+	// a LeaveGroup request itself; Consume sends one when its ctx has been cancelled.
+	Close() error
+}
+
+type consumerGroup struct {
+	client   Client
+	conf     *Config
+	consumer Consumer
+	groupID  string
+
+	lock   sync.Mutex
+	errors chan error
+
+	closed    chan none
+	closeOnce sync.Once
+}
+
+// NewConsumerGroup creates a new ConsumerGroup using the given broker addresses and configuration.
+func NewConsumerGroup(addrs []string, groupID string, config *Config) (ConsumerGroup, error) {
+	client, err := NewClient(addrs, config)
+	if err != nil {
+		return nil, err
+	}
+
+	cg, err := newConsumerGroup(groupID, client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// NewConsumerGroupFromClient creates a new ConsumerGroup from the given client. It is still
+// necessary to call Close() on the underlying client when finished with the consumer group.
+func NewConsumerGroupFromClient(groupID string, client Client) (ConsumerGroup, error) {
+	return newConsumerGroup(groupID, client)
+}
+
+func newConsumerGroup(groupID string, client Client) (*consumerGroup, error) {
+	if client.Closed() {
+		return nil, ErrClosedClient
+	}
+
+	consumer, err := NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &consumerGroup{
+		client:   client,
+		conf:     client.Config(),
+		consumer: consumer,
+		groupID:  groupID,
+		errors:   make(chan error, client.Config().ChannelBufferSize),
+		closed:   make(chan none),
+	}, nil
+}
+
+func (c *consumerGroup) Errors() <-chan error { return c.errors }
+
+func (c *consumerGroup) Close() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		if e := c.consumer.Close(); e != nil {
+			err = e
+		}
+
+		close(c.errors)
+	})
+	return
+}
+
+func (c *consumerGroup) handleError(err error) {
+	if c.conf.Consumer.Return.Errors {
+		select {
+		case c.errors <- err:
+		default:
+		}
+	} else {
+		Logger.Println(err)
+	}
+}
+
+// Consume joins the group, obtains a partition assignment and runs handler against it until the
+// generation is invalidated (by a rebalance, a fatal error, or ctx being cancelled).
+func (c *consumerGroup) Consume(ctx context.Context, topics []string, handler ConsumerGroupHandler) error {
+	select {
+	case <-c.closed:
+		return ErrClosedConsumerGroup
+	default:
+	}
+
+	coordinator, err := c.client.Coordinator(c.groupID)
+	if err != nil {
+		return err
+	}
+
+	memberID, generationID, claims, err := c.joinAndSync(coordinator, topics)
+	if err != nil {
+		return err
+	}
+
+	sess, err := c.newSession(ctx, coordinator, memberID, generationID, claims, handler)
+	if err != nil {
+		return err
+	}
+
+	if err := handler.Setup(sess); err != nil {
+		sess.release()
+		return err
+	}
+
+	sess.run()
+
+	if err := handler.Cleanup(sess); err != nil {
+		sess.release()
+		return err
+	}
+
+	sess.release()
+
+	if ctx.Err() != nil {
+		if err := c.leave(coordinator, memberID); err != nil {
+			c.handleError(err)
+		}
+	}
+
+	if err := sess.err; err != nil && err != ErrRebalanceInProgress && err != ErrIllegalGeneration {
+		return err
+	}
+	return nil
+}
+
+// joinAndSync drives the JoinGroup/SyncGroup handshake and returns this member's id, the group's
+// generation, and the partitions it was assigned.
+func (c *consumerGroup) joinAndSync(coordinator *Broker, topics []string) (memberID string, generationID int32, claims map[string][]int32, err error) {
+	strategy := c.conf.Consumer.Group.Rebalance.Strategy
+	if strategy == nil {
+		strategy = BalanceStrategyRange
+	}
+
+	for {
+		var join *JoinGroupResponse
+		join, err = c.joinGroup(coordinator, memberID, topics, strategy)
+		if err != nil {
+			return
+		}
+
+		switch join.Err {
+		case ErrNoError:
+			// fall through below
+		case ErrUnknownMemberId:
+			memberID = ""
+			continue
+		case ErrRebalanceInProgress:
+			continue
+		default:
+			err = join.Err
+			return
+		}
+
+		memberID = join.MemberId
+		generationID = join.GenerationId
+
+		var groupAssignments map[string][]byte
+		if join.LeaderId == join.MemberId {
+			groupAssignments, err = c.assignGroup(join, strategy)
+			if err != nil {
+				return
+			}
+		}
+
+		var sync *SyncGroupResponse
+		sync, err = c.syncGroup(coordinator, memberID, generationID, groupAssignments)
+		if err != nil {
+			return
+		}
+
+		switch sync.Err {
+		case ErrNoError:
+			var assignment *ConsumerGroupMemberAssignment
+			assignment, err = sync.GetMemberAssignment()
+			if err != nil {
+				return
+			}
+			claims = assignment.Topics
+			return
+		case ErrRebalanceInProgress, ErrIllegalGeneration:
+			continue
+		default:
+			err = sync.Err
+			return
+		}
+	}
+}
+
+func (c *consumerGroup) joinGroup(coordinator *Broker, memberID string, topics []string, strategy BalanceStrategy) (*JoinGroupResponse, error) {
+	req := &JoinGroupRequest{
+		GroupId:        c.groupID,
+		SessionTimeout: int32(c.conf.Consumer.Group.Session.Timeout / time.Millisecond),
+		MemberId:       memberID,
+		ProtocolType:   "consumer",
+	}
+	meta := &ConsumerGroupMemberMetadata{Version: 1, Topics: topics}
+	if err := req.AddGroupProtocolMetadata(strategy.Name(), meta); err != nil {
+		return nil, err
+	}
+
+	return coordinator.JoinGroup(req)
+}
+
+func (c *consumerGroup) assignGroup(join *JoinGroupResponse, strategy BalanceStrategy) (map[string][]byte, error) {
+	members, err := join.GetMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make(map[string][]int32)
+	for _, meta := range members {
+		for _, topic := range meta.Topics {
+			if _, ok := topics[topic]; ok {
+				continue
+			}
+			partitions, err := c.client.Partitions(topic)
+			if err != nil {
+				return nil, err
+			}
+			topics[topic] = partitions
+		}
+	}
+
+	plan, err := strategy.Plan(members, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	groupAssignments := make(map[string][]byte, len(plan))
+	for memberID, assignedTopics := range plan {
+		assignment := &ConsumerGroupMemberAssignment{Version: 1, Topics: assignedTopics}
+		bin, err := encode(assignment, nil)
+		if err != nil {
+			return nil, err
+		}
+		groupAssignments[memberID] = bin
+	}
+
+	return groupAssignments, nil
+}
+
+func (c *consumerGroup) syncGroup(coordinator *Broker, memberID string, generationID int32, groupAssignments map[string][]byte) (*SyncGroupResponse, error) {
+	req := &SyncGroupRequest{
+		GroupId:          c.groupID,
+		GenerationId:     generationID,
+		MemberId:         memberID,
+		GroupAssignments: groupAssignments,
+	}
+
+	return coordinator.SyncGroup(req)
+}
+
+func (c *consumerGroup) heartbeat(coordinator *Broker, memberID string, generationID int32) error {
+	resp, err := coordinator.Heartbeat(&HeartbeatRequest{
+		GroupId:      c.groupID,
+		GenerationId: generationID,
+		MemberId:     memberID,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Err != ErrNoError {
+		return resp.Err
+	}
+	return nil
+}
+
+func (c *consumerGroup) leave(coordinator *Broker, memberID string) error {
+	resp, err := coordinator.LeaveGroup(&LeaveGroupRequest{
+		GroupId:  c.groupID,
+		MemberId: memberID,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Err != ErrNoError && resp.Err != ErrUnknownMemberId {
+		return resp.Err
+	}
+	return nil
+}
+
+// ConsumerGroupHandler is the interface a consumer must implement to process the claims handed
+// out by a ConsumerGroup; it mirrors the lifecycle of a single generation.
+type ConsumerGroupHandler interface {
+	// Setup is run at the beginning of a new session, before ConsumeClaim.
+	Setup(ConsumerGroupSession) error
+
+	// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited but
+	// before the offsets are committed for the last time.
+	Cleanup(ConsumerGroupSession) error
+
+	// ConsumeClaim is called within a goroutine, once per claimed partition. Once the Messages()
+	// channel is closed, the handler must finish its processing loop and exit.
+	ConsumeClaim(ConsumerGroupSession, ConsumerGroupClaim) error
+}
+
+// ConsumerGroupSession represents a consumer group member's view of a single generation: the
+// partitions it was assigned and the means to record progress against them.
+type ConsumerGroupSession interface {
+	// Claims returns the partitions assigned to this session, keyed by topic.
+	Claims() map[string][]int32
+
+	// MemberID returns this member's group member id for the current generation.
+	MemberID() string
+
+	// GenerationID returns the current generation id.
+	GenerationID() int32
+
+	// MarkOffset marks the provided offset as processed, alongside metadata, for the given
+	// topic/partition. See MarkMessage for a shorthand that operates on a *ConsumerMessage.
+	MarkOffset(topic string, partition int32, offset int64, metadata string)
+
+	// MarkMessage marks the provided message as processed, alongside metadata.
+	MarkMessage(msg *ConsumerMessage, metadata string)
+
+	// Context returns the context for this session, cancelled when the session ends.
+	Context() context.Context
+}
+
+// ConsumerGroupClaim processes Kafka messages from a given topic/partition within a consumer
+// group session.
+type ConsumerGroupClaim interface {
+	Topic() string
+	Partition() int32
+
+	// InitialOffset returns the offset used as the starting point for this claim.
+	InitialOffset() int64
+
+	// HighWaterMarkOffset returns the high water mark offset for the partition, as reported by
+	// the broker with the most recently consumed message.
+	HighWaterMarkOffset() int64
+
+	// Messages returns the read channel for the messages claimed from this topic/partition.
+	Messages() <-chan *ConsumerMessage
+}
+
+type consumerGroupSession struct {
+	parent       *consumerGroup
+	coordinator  *Broker
+	memberID     string
+	generationID int32
+	claims       map[string][]int32
+
+	offsets OffsetManager
+	poms    map[string]map[int32]PartitionOffsetManager
+
+	claimed []*consumerGroupClaim
+
+	ctx    context.Context
+	cancel func()
+
+	waitGroup sync.WaitGroup
+
+	hbDone chan none
+	err    error
+}
+
+func (c *consumerGroup) newSession(ctx context.Context, coordinator *Broker, memberID string, generationID int32, claims map[string][]int32, handler ConsumerGroupHandler) (*consumerGroupSession, error) {
+	offsets, err := newOffsetManagerFromClient(c.groupID, memberID, generationID, c.client)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	sess := &consumerGroupSession{
+		parent:       c,
+		coordinator:  coordinator,
+		memberID:     memberID,
+		generationID: generationID,
+		claims:       claims,
+		offsets:      offsets,
+		poms:         make(map[string]map[int32]PartitionOffsetManager),
+		ctx:          ctx,
+		cancel:       cancel,
+		hbDone:       make(chan none),
+	}
+
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			pom, err := offsets.ManagePartition(topic, partition)
+			if err != nil {
+				sess.release()
+				return nil, err
+			}
+
+			offset := pom.Offset()
+			if offset < 0 {
+				offset = c.conf.Consumer.Offsets.Initial
+			}
+
+			pcc, err := c.consumer.ConsumePartition(topic, partition, offset)
+			if err != nil {
+				sess.release()
+				return nil, err
+			}
+
+			if sess.poms[topic] == nil {
+				sess.poms[topic] = make(map[int32]PartitionOffsetManager)
+			}
+			sess.poms[topic][partition] = pom
+
+			claim := &consumerGroupClaim{
+				topic:         topic,
+				partition:     partition,
+				pcc:           pcc,
+				pom:           pom,
+				initialOffset: offset,
+			}
+			sess.claimed = append(sess.claimed, claim)
+
+			sess.waitGroup.Add(1)
+			go func() {
+				defer sess.waitGroup.Done()
+				if err := handler.ConsumeClaim(sess, claim); err != nil {
+					c.handleError(err)
+				}
+			}()
+		}
+	}
+
+	go withRecover(sess.heartbeatLoop)
+
+	return sess, nil
+}
+
+func (s *consumerGroupSession) Claims() map[string][]int32 { return s.claims }
+func (s *consumerGroupSession) MemberID() string           { return s.memberID }
+func (s *consumerGroupSession) GenerationID() int32        { return s.generationID }
+func (s *consumerGroupSession) Context() context.Context   { return s.ctx }
+
+func (s *consumerGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	if pom := s.poms[topic][partition]; pom != nil {
+		pom.SetOffset(offset)
+		pom.SetMetadata(metadata)
+	}
+}
+
+func (s *consumerGroupSession) MarkMessage(msg *ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// run blocks until every claim's ConsumeClaim goroutine has returned, the session's context is
+// cancelled, or a rebalance is signalled by the heartbeat loop.
+func (s *consumerGroupSession) run() {
+	done := make(chan none)
+	go func() {
+		s.waitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-s.ctx.Done():
+	case <-s.hbDone:
+	}
+}
+
+func (s *consumerGroupSession) heartbeatLoop() {
+	defer close(s.hbDone)
+
+	interval := s.parent.conf.Consumer.Group.Heartbeat.Interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.parent.heartbeat(s.coordinator, s.memberID, s.generationID)
+			switch err {
+			case nil:
+				continue
+			case ErrRebalanceInProgress, ErrIllegalGeneration, ErrUnknownMemberId:
+				s.err = err
+				s.cancel()
+				return
+			default:
+				s.parent.handleError(err)
+				s.err = err
+				s.cancel()
+				return
+			}
+		}
+	}
+}
+
+// release ends the session: it cancels ctx, asks every claimed PartitionConsumer to close (which
+// closes its Messages() channel, letting the ConsumeClaim goroutine ranging over it return so
+// waitGroup.Wait() below doesn't block forever), and finally closes the OffsetManager so every
+// partition's last-known offset is flushed.
+func (s *consumerGroupSession) release() {
+	s.cancel()
+
+	for _, claim := range s.claimed {
+		claim.pcc.AsyncClose()
+	}
+	s.waitGroup.Wait()
+
+	if err := s.offsets.Close(); err != nil {
+		s.parent.handleError(err)
+	}
+}
+
+type consumerGroupClaim struct {
+	topic     string
+	partition int32
+	pcc       PartitionConsumer
+	pom       PartitionOffsetManager
+
+	// initialOffset is the offset ConsumePartition was actually started from; unlike pom.Offset(),
+	// it doesn't change as the session marks later offsets, so it keeps InitialOffset's documented
+	// contract of reporting the starting point for this claim.
+	initialOffset int64
+}
+
+func (c *consumerGroupClaim) Topic() string                     { return c.topic }
+func (c *consumerGroupClaim) Partition() int32                  { return c.partition }
+func (c *consumerGroupClaim) InitialOffset() int64              { return c.initialOffset }
+func (c *consumerGroupClaim) HighWaterMarkOffset() int64        { return c.pcc.HighWaterMarkOffset() }
+func (c *consumerGroupClaim) Messages() <-chan *ConsumerMessage { return c.pcc.Messages() }
@@ -0,0 +1,104 @@
+package sarama
+
+import "sort"
+
+// BalanceStrategyPlan is the distribution plan produced by a BalanceStrategy: for each member
+// id, the partitions of each topic it should consume.
+type BalanceStrategyPlan map[string]map[string][]int32
+
+// Add accumulates a partition assignment for the given member/topic into the plan.
+func (p BalanceStrategyPlan) Add(memberID, topic string, partitions ...int32) {
+	if len(partitions) == 0 {
+		return
+	}
+	if p[memberID] == nil {
+		p[memberID] = make(map[string][]int32, 1)
+	}
+	p[memberID][topic] = append(p[memberID][topic], partitions...)
+}
+
+// BalanceStrategy is a simplified group-membership assignment strategy: given the members of a
+// group and the partitions available on each topic they are interested in, it decides which
+// partitions go to which member.
+type BalanceStrategy interface {
+	// Name uniquely identifies the strategy and is sent as part of the JoinGroupRequest so the
+	// group coordinator can select a protocol every member supports.
+	Name() string
+
+	// Plan builds a partition assignment from the given members and topic/partition map.
+	Plan(members map[string]ConsumerGroupMemberMetadata, topics map[string][]int32) (BalanceStrategyPlan, error)
+}
+
+// BalanceStrategyRange assigns partition ranges to members of the consumer group, in member-id
+// sorted order, one topic at a time (mirrors Kafka's default java RangeAssignor).
+var BalanceStrategyRange = &balanceStrategy{
+	name: "range",
+	coreFn: func(plan BalanceStrategyPlan, memberIDs []string, topic string, partitions []int32) {
+		partitionsPerMember := len(partitions) / len(memberIDs)
+		extraPartitions := len(partitions) % len(memberIDs)
+
+		for i, memberID := range memberIDs {
+			count := partitionsPerMember
+			if i < extraPartitions {
+				count++
+			}
+
+			start := i*partitionsPerMember + min(i, extraPartitions)
+			plan.Add(memberID, topic, partitions[start:start+count]...)
+		}
+	},
+}
+
+// BalanceStrategyRoundRobin assigns each topic's partitions to the members interested in that
+// topic in a round-robin fashion, in member-id sorted order. Every topic is dealt out on its own,
+// starting again from the first member, rather than across all topics together as Kafka's java
+// RoundRobinAssignor does.
+var BalanceStrategyRoundRobin = &balanceStrategy{
+	name: "roundrobin",
+	coreFn: func(plan BalanceStrategyPlan, memberIDs []string, topic string, partitions []int32) {
+		for i, partition := range partitions {
+			memberID := memberIDs[i%len(memberIDs)]
+			plan.Add(memberID, topic, partition)
+		}
+	},
+}
+
+type balanceStrategy struct {
+	name   string
+	coreFn func(plan BalanceStrategyPlan, memberIDs []string, topic string, partitions []int32)
+}
+
+func (s *balanceStrategy) Name() string { return s.name }
+
+func (s *balanceStrategy) Plan(members map[string]ConsumerGroupMemberMetadata, topics map[string][]int32) (BalanceStrategyPlan, error) {
+	// build a sorted list of topic -> interested members, then run the strategy's core
+	// assignment function independently for each topic.
+	memberIDsByTopic := make(map[string][]string)
+	for memberID, meta := range members {
+		for _, topic := range meta.Topics {
+			memberIDsByTopic[topic] = append(memberIDsByTopic[topic], memberID)
+		}
+	}
+
+	plan := make(BalanceStrategyPlan, len(members))
+	for topic, memberIDs := range memberIDsByTopic {
+		partitions := topics[topic]
+		if len(partitions) == 0 || len(memberIDs) == 0 {
+			continue
+		}
+
+		sort.Strings(memberIDs)
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+
+		s.coreFn(plan, memberIDs, topic, partitions)
+	}
+
+	return plan, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,80 @@
+package sarama
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBalanceStrategyRange(t *testing.T) {
+	members := map[string]ConsumerGroupMemberMetadata{
+		"M1": {Topics: []string{"T1", "T2"}},
+		"M2": {Topics: []string{"T1", "T2"}},
+	}
+	topics := map[string][]int32{
+		"T1": {0, 1, 2},
+		"T2": {0, 1},
+	}
+
+	plan, err := BalanceStrategyRange.Plan(members, topics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := BalanceStrategyPlan{
+		"M1": {"T1": {0, 1}, "T2": {0}},
+		"M2": {"T1": {2}, "T2": {1}},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("unexpected plan: %#v", plan)
+	}
+}
+
+func TestBalanceStrategyRoundRobin(t *testing.T) {
+	members := map[string]ConsumerGroupMemberMetadata{
+		"M1": {Topics: []string{"T1"}},
+		"M2": {Topics: []string{"T1"}},
+	}
+	topics := map[string][]int32{
+		"T1": {0, 1, 2, 3},
+	}
+
+	plan, err := BalanceStrategyRoundRobin.Plan(members, topics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := BalanceStrategyPlan{
+		"M1": {"T1": {0, 2}},
+		"M2": {"T1": {1, 3}},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("unexpected plan: %#v", plan)
+	}
+}
+
+func TestBalanceStrategyPlanCoversEveryPartitionExactlyOnce(t *testing.T) {
+	members := map[string]ConsumerGroupMemberMetadata{
+		"M1": {Topics: []string{"T1"}},
+		"M2": {Topics: []string{"T1"}},
+		"M3": {Topics: []string{"T1"}},
+	}
+	topics := map[string][]int32{"T1": {0, 1, 2, 3, 4}}
+
+	for _, strategy := range []BalanceStrategy{BalanceStrategyRange, BalanceStrategyRoundRobin} {
+		plan, err := strategy.Plan(members, topics)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var assigned []int32
+		for _, byTopic := range plan {
+			assigned = append(assigned, byTopic["T1"]...)
+		}
+		sort.Slice(assigned, func(i, j int) bool { return assigned[i] < assigned[j] })
+
+		if !reflect.DeepEqual(assigned, []int32{0, 1, 2, 3, 4}) {
+			t.Errorf("%s: expected every partition assigned exactly once, got %v", strategy.Name(), assigned)
+		}
+	}
+}
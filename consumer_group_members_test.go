@@ -0,0 +1,54 @@
+package sarama
+
+import "testing"
+
+var (
+	groupMemberMetadataEmpty = []byte{
+		0, 1, // Version
+		0, 0, 0, 0, // Topics: empty array
+		0, 0, 0, 0, // UserData: empty
+	}
+
+	groupMemberMetadataOneTopic = []byte{
+		0, 1, // Version
+		0, 0, 0, 1, // Topics: one entry
+		0, 3, 'f', 'o', 'o', // "foo"
+		0, 0, 0, 3, 0x01, 0x02, 0x03, // UserData
+	}
+)
+
+func TestConsumerGroupMemberMetadata(t *testing.T) {
+	testVersionDecodable(t, "empty", new(ConsumerGroupMemberMetadata), groupMemberMetadataEmpty, 0)
+	testEncodable(t, "empty", &ConsumerGroupMemberMetadata{Version: 1, UserData: []byte{}}, groupMemberMetadataEmpty)
+
+	meta := &ConsumerGroupMemberMetadata{
+		Version:  1,
+		Topics:   []string{"foo"},
+		UserData: []byte{0x01, 0x02, 0x03},
+	}
+	testEncodable(t, "one topic", meta, groupMemberMetadataOneTopic)
+}
+
+func TestConsumerGroupMemberAssignment(t *testing.T) {
+	assignment := &ConsumerGroupMemberAssignment{
+		Version: 1,
+		Topics:  map[string][]int32{"foo": {0, 1, 2}},
+	}
+
+	bin, err := encode(assignment, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := new(ConsumerGroupMemberAssignment)
+	if err := decode(bin, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Version != assignment.Version {
+		t.Errorf("expected version %d, got %d", assignment.Version, decoded.Version)
+	}
+	if len(decoded.Topics["foo"]) != 3 {
+		t.Errorf("expected 3 partitions for foo, got %v", decoded.Topics["foo"])
+	}
+}
@@ -0,0 +1,34 @@
+package sarama
+
+import "testing"
+
+var (
+	joinGroupRequestNoProtocols = []byte{
+		0, 3, 'f', 'o', 'o', // GroupId
+		0, 0, 0, 100, // SessionTimeout
+		0, 0, // MemberId
+		0, 3, 'b', 'a', 'r', // ProtocolType
+		0, 0, 0, 0, // GroupProtocols: empty array
+	}
+
+	joinGroupRequestOneProtocol = []byte{
+		0, 3, 'f', 'o', 'o', // GroupId
+		0, 0, 0, 100, // SessionTimeout
+		0, 0, // MemberId
+		0, 3, 'b', 'a', 'r', // ProtocolType
+		0, 0, 0, 1, // GroupProtocols: one entry
+		0, 5, 'r', 'a', 'n', 'g', 'e', // protocol name
+		0, 0, 0, 3, 0x01, 0x02, 0x03, // protocol metadata
+	}
+)
+
+func TestJoinGroupRequest(t *testing.T) {
+	request := new(JoinGroupRequest)
+	request.GroupId = "foo"
+	request.SessionTimeout = 100
+	request.ProtocolType = "bar"
+	testRequest(t, "no protocols", request, joinGroupRequestNoProtocols)
+
+	request.AddGroupProtocol("range", []byte{0x01, 0x02, 0x03})
+	testRequest(t, "one protocol", request, joinGroupRequestOneProtocol)
+}
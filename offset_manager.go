@@ -1,17 +1,71 @@
 package sarama
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
 
 // Offset Manager
 
+// OffsetManagerError is sent down a PartitionOffsetManager's Errors channel whenever a request
+// concerning that partition's committed offset fails. Retriable reports whether Err is a
+// transient condition that the offset manager retries internally - a coordinator still loading
+// offsets or no longer coordinating the group (ErrOffsetsLoadInProgress,
+// ErrNotCoordinatorForConsumer), a failure to look up the coordinator, or a network error
+// talking to it - as opposed to a fatal misconfiguration the caller needs to act on.
+type OffsetManagerError struct {
+	Topic     string
+	Partition int32
+	Err       error
+	Retriable bool
+}
+
+func (oe *OffsetManagerError) Error() string {
+	return fmt.Sprintf("kafka: offset manager error for %s/%d: %s", oe.Topic, oe.Partition, oe.Err)
+}
+
+// OffsetManagerErrors is returned from OffsetManager.Close or PartitionOffsetManager.Close when
+// one or more errors occurred while flushing outstanding commits. It mirrors the
+// ConsumerErrors aggregate returned from Consumer.Close.
+type OffsetManagerErrors []*OffsetManagerError
+
+func (oe OffsetManagerErrors) Error() string {
+	return fmt.Sprintf("kafka: %d errors while closing offset manager", len(oe))
+}
+
+// isRetriableKError reports whether kerr is a transient coordinator condition that is worth
+// retrying with backoff rather than surfacing immediately or forcing a rebalance.
+func isRetriableKError(kerr KError) bool {
+	switch kerr {
+	case ErrOffsetsLoadInProgress, ErrNotCoordinatorForConsumer:
+		return true
+	default:
+		return false
+	}
+}
+
 // OffsetManager uses Kafka to store and fetch consumed partition offsets.
 type OffsetManager interface {
 	// ManagePartition creates a PartitionOffsetManager on the given topic/partition. It will
 	// return an error if this OffsetManager is already managing the given topic/partition.
 	ManagePartition(topic string, partition int32) (PartitionOffsetManager, error)
+
+	// CommitOffsets flushes the offsets of every partition this OffsetManager is managing to
+	// their respective brokers and waits for the responses, instead of waiting for the next tick
+	// of Config.Consumer.Offsets.CommitInterval. It returns an OffsetManagerErrors aggregating
+	// the errors queued on the PartitionOffsetManagers' Errors channels; errors are only queued
+	// there when Config.Consumer.Return.Errors is enabled, otherwise they are logged and
+	// CommitOffsets returns nil.
+	CommitOffsets() error
+
+	// Close stops the OffsetManager from managing offsets. It closes every PartitionOffsetManager
+	// it owns, flushing a final commit for each, and aggregates the errors queued on their Errors
+	// channels (only when Config.Consumer.Return.Errors is enabled; otherwise errors are logged)
+	// into an OffsetManagerErrors. It is required to call this function before an
+	// OffsetManager object passes out of scope, as it will otherwise leak memory; callers do not
+	// need to close their PartitionOffsetManagers themselves first.
+	Close() error
 }
 
 type offsetManager struct {
@@ -19,6 +73,13 @@ type offsetManager struct {
 	conf   *Config
 	group  string
 
+	// memberID and generationID identify the consumer group generation this offsetManager is
+	// committing on behalf of, if any; they are included in every OffsetCommitRequest so the
+	// coordinator can reject commits from a member that has fallen out of the group. A plain
+	// OffsetManager (not tied to a ConsumerGroup generation) leaves generationID at -1.
+	memberID     string
+	generationID int32
+
 	lock sync.Mutex
 	poms map[string]map[int32]*partitionOffsetManager
 	boms map[*Broker]*brokerOffsetManager
@@ -27,16 +88,26 @@ type offsetManager struct {
 // NewOffsetManagerFromClient creates a new OffsetManager from the given client.
 // It is still necessary to call Close() on the underlying client when finished with the partition manager.
 func NewOffsetManagerFromClient(client Client) (OffsetManager, error) {
+	return newOffsetManagerFromClient("", "", -1, client)
+}
+
+// newOffsetManagerFromClient is the internal constructor shared by NewOffsetManagerFromClient and
+// the ConsumerGroup session, which additionally needs the offsetManager to stamp every commit
+// with its group membership and generation.
+func newOffsetManagerFromClient(group, memberID string, generationID int32, client Client) (*offsetManager, error) {
 	// Check that we are not dealing with a closed Client before processing any other arguments
 	if client.Closed() {
 		return nil, ErrClosedClient
 	}
 
 	om := &offsetManager{
-		client: client,
-		conf:   client.Config(),
-		poms:   make(map[string]map[int32]*partitionOffsetManager),
-		boms:   make(map[*Broker]*brokerOffsetManager),
+		client:       client,
+		conf:         client.Config(),
+		group:        group,
+		memberID:     memberID,
+		generationID: generationID,
+		poms:         make(map[string]map[int32]*partitionOffsetManager),
+		boms:         make(map[*Broker]*brokerOffsetManager),
 	}
 
 	return om, nil
@@ -101,6 +172,92 @@ func (om *offsetManager) abandonBroker(bom *brokerOffsetManager) {
 	delete(om.boms, bom.broker)
 }
 
+func (om *offsetManager) CommitOffsets() error {
+	om.lock.Lock()
+	boms := make([]*brokerOffsetManager, 0, len(om.boms))
+	for _, bom := range om.boms {
+		boms = append(boms, bom)
+	}
+	om.lock.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(boms))
+	for _, bom := range boms {
+		go func(bom *brokerOffsetManager) {
+			defer wg.Done()
+			bom.flushAndWait()
+		}(bom)
+	}
+	wg.Wait()
+
+	return om.drainErrors()
+}
+
+// drainErrors non-blockingly collects whatever errors partitionOffsetManagers have queued up,
+// aggregating them the same way Close does.
+func (om *offsetManager) drainErrors() error {
+	om.lock.Lock()
+	defer om.lock.Unlock()
+
+	var errs OffsetManagerErrors
+	for _, topicManagers := range om.poms {
+		for _, pom := range topicManagers {
+		drain:
+			for {
+				select {
+				case err := <-pom.errors:
+					errs = append(errs, err)
+				default:
+					break drain
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Close stops every partitionOffsetManager this OffsetManager owns, flushing a final commit for
+// each, and aggregates any errors encountered along the way.
+func (om *offsetManager) Close() error {
+	om.lock.Lock()
+	var poms []*partitionOffsetManager
+	for _, topicManagers := range om.poms {
+		for _, pom := range topicManagers {
+			poms = append(poms, pom)
+		}
+	}
+	om.lock.Unlock()
+
+	errs := make(chan OffsetManagerErrors, len(poms))
+
+	var wg sync.WaitGroup
+	wg.Add(len(poms))
+	for _, pom := range poms {
+		go func(pom *partitionOffsetManager) {
+			defer wg.Done()
+			if err := pom.Close(); err != nil {
+				errs <- err.(OffsetManagerErrors)
+			}
+		}(pom)
+	}
+	wg.Wait()
+	close(errs)
+
+	var aggregate OffsetManagerErrors
+	for sub := range errs {
+		aggregate = append(aggregate, sub...)
+	}
+
+	if len(aggregate) > 0 {
+		return aggregate
+	}
+	return nil
+}
+
 // Partition Offset Manager
 
 // PartitionOffsetManager uses Kafka to store and fetch consumed partition offsets. You MUST call Close()
@@ -114,7 +271,7 @@ type PartitionOffsetManager interface {
 	Metadata() string
 	SetMetadata(metadata string)
 
-	Errors() <-chan error
+	Errors() <-chan *OffsetManagerError
 	AsyncClose()
 	Close() error
 }
@@ -129,8 +286,10 @@ type partitionOffsetManager struct {
 	metadata string
 	broker   *brokerOffsetManager
 
-	errors    chan error
+	errors    chan *OffsetManagerError
 	rebalance chan none
+	closed    chan none
+	done      chan none
 }
 
 func (om *offsetManager) newPartitionOffsetManager(topic string, partition int32) (*partitionOffsetManager, error) {
@@ -138,15 +297,17 @@ func (om *offsetManager) newPartitionOffsetManager(topic string, partition int32
 		parent:    om,
 		topic:     topic,
 		partition: partition,
-		errors:    make(chan error, om.conf.ChannelBufferSize),
+		errors:    make(chan *OffsetManagerError, om.conf.ChannelBufferSize),
 		rebalance: make(chan none, 1),
+		closed:    make(chan none),
+		done:      make(chan none),
 	}
 
 	if err := pom.selectBroker(); err != nil {
 		return nil, err
 	}
 
-	if err := pom.fetchInitialOffset(); err != nil {
+	if err := pom.fetchInitialOffset(om.conf.Metadata.Retry.Max, om.conf.Metadata.Retry.Backoff); err != nil {
 		return nil, err
 	}
 
@@ -155,19 +316,61 @@ func (om *offsetManager) newPartitionOffsetManager(topic string, partition int32
 	return pom, nil
 }
 
+// mainLoop re-selects a coordinator every time a rebalance is signalled (by selectBroker
+// failing, or by flushToBroker/abort noticing the coordinator moved or became unreachable), retrying with
+// a bounded exponential backoff rather than busy-looping against a coordinator that is still
+// unavailable. It owns pom.broker for the lifetime of the partitionOffsetManager (selectBroker is
+// only ever called from here, or synchronously from newPartitionOffsetManager before this
+// goroutine is started) and exits as soon as AsyncClose closes pom.closed, so no rebalance queued
+// behind it can run handleError/re-subscribe after pom.errors has been closed.
 func (pom *partitionOffsetManager) mainLoop() {
-	for _ = range pom.rebalance {
+	defer close(pom.done)
+
+	backoff := pom.parent.conf.Metadata.Retry.Backoff
+	maxBackoff := backoff * time.Duration(pom.parent.conf.Metadata.Retry.Max)
+	current := backoff
+
+	for {
+		select {
+		case <-pom.closed:
+			return
+		case <-pom.rebalance:
+		}
+
 		if err := pom.selectBroker(); err != nil {
-			pom.handleError(err)
-			pom.rebalance <- none{}
+			pom.handleError(err, true)
+
+			select {
+			case <-pom.closed:
+				return
+			case <-time.After(current):
+			}
+
+			current *= 2
+			if current > maxBackoff {
+				current = maxBackoff
+			}
+
+			select {
+			case pom.rebalance <- none{}:
+			case <-pom.closed:
+				return
+			}
+			continue
 		}
+
+		current = backoff
 	}
 }
 
 func (pom *partitionOffsetManager) selectBroker() error {
-	if pom.broker != nil {
-		pom.parent.unrefBrokerOffsetManager(pom.broker)
-		pom.broker = nil
+	pom.lock.Lock()
+	oldBroker := pom.broker
+	pom.broker = nil
+	pom.lock.Unlock()
+
+	if oldBroker != nil {
+		pom.parent.unrefBrokerOffsetManager(oldBroker)
 	}
 
 	var broker *Broker
@@ -181,12 +384,22 @@ func (pom *partitionOffsetManager) selectBroker() error {
 		return err
 	}
 
-	pom.broker = pom.parent.refBrokerOffsetManager(broker)
-	pom.broker.newSubscriptions <- pom
+	newBroker := pom.parent.refBrokerOffsetManager(broker)
+
+	pom.lock.Lock()
+	pom.broker = newBroker
+	pom.lock.Unlock()
+
+	newBroker.newSubscriptions <- pom
 	return nil
 }
 
-func (pom *partitionOffsetManager) fetchInitialOffset() error {
+// fetchInitialOffset fetches the partition's committed offset, retrying up to retries times
+// with a bounded exponential backoff (refreshing the coordinator each time) when the coordinator
+// reports it is still loading offsets or isn't the coordinator for this group any more. Any other
+// KError is fatal and is returned as-is, rather than the nil network error fetchInitialOffset used
+// to return for it.
+func (pom *partitionOffsetManager) fetchInitialOffset(retries int, backoff time.Duration) error {
 	request := new(OffsetFetchRequest)
 	request.Version = 1 // TODO should the version be configurable?
 	request.ConsumerGroup = pom.parent.group
@@ -207,22 +420,40 @@ func (pom *partitionOffsetManager) fetchInitialOffset() error {
 		pom.offset = block.Offset
 		pom.metadata = block.Metadata
 		return nil
+	case ErrOffsetsLoadInProgress, ErrNotCoordinatorForConsumer:
+		if retries <= 0 {
+			return block.Err
+		}
+
+		time.Sleep(backoff)
+
+		if err := pom.parent.client.RefreshCoordinator(pom.parent.group); err != nil {
+			return err
+		}
+		if err := pom.selectBroker(); err != nil {
+			return err
+		}
+
+		return pom.fetchInitialOffset(retries-1, backoff*2)
 	default:
-		// TODO what other errors can occur here, should we retry some of them?
-		return err
+		return block.Err
 	}
 }
 
-func (pom *partitionOffsetManager) handleError(err error) {
-	// TODO should OffsetManager have its own section of `Config` or should it just borrow Consumer's?
+func (pom *partitionOffsetManager) handleError(err error, retriable bool) {
 	if pom.parent.conf.Consumer.Return.Errors {
-		pom.errors <- err
+		pom.errors <- &OffsetManagerError{
+			Topic:     pom.topic,
+			Partition: pom.partition,
+			Err:       err,
+			Retriable: retriable,
+		}
 	} else {
 		Logger.Println(err)
 	}
 }
 
-func (pom *partitionOffsetManager) Errors() <-chan error {
+func (pom *partitionOffsetManager) Errors() <-chan *OffsetManagerError {
 	return pom.errors
 }
 
@@ -254,34 +485,64 @@ func (pom *partitionOffsetManager) Metadata() string {
 	return pom.metadata
 }
 
+// AsyncClose signals mainLoop to stop (so no rebalance still in flight can touch pom after this
+// returns) and, once mainLoop has actually exited, flushes a final commit and closes pom.errors.
 func (pom *partitionOffsetManager) AsyncClose() {
-	// TODO implement me
+	close(pom.closed)
+
+	go func() {
+		<-pom.done
+
+		pom.lock.Lock()
+		broker := pom.broker
+		pom.lock.Unlock()
+
+		if broker != nil {
+			broker.flushPartition(pom)
+			broker.removeSubscriptions <- pom
+			pom.parent.unrefBrokerOffsetManager(broker)
+		}
+
+		close(pom.errors)
+	}()
 }
 
 func (pom *partitionOffsetManager) Close() error {
 	pom.AsyncClose()
-	// TODO read from errors (do we need another error type a la ConsumerError(s)?)
+
+	var errs OffsetManagerErrors
+	for err := range pom.errors {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
 // Broker Offset Manager
 
 type brokerOffsetManager struct {
-	parent           *offsetManager
-	broker           *Broker
-	timer            *time.Ticker
-	newSubscriptions chan *partitionOffsetManager
-	subscriptions    map[*partitionOffsetManager]none
-	refs             int
+	parent              *offsetManager
+	broker              *Broker
+	timer               *time.Ticker
+	newSubscriptions    chan *partitionOffsetManager
+	removeSubscriptions chan *partitionOffsetManager
+	flushNow            chan chan none
+	subscriptions       map[*partitionOffsetManager]none
+	refs                int
 }
 
 func (om *offsetManager) newBrokerOffsetManager(broker *Broker) *brokerOffsetManager {
 	bom := &brokerOffsetManager{
-		parent:           om,
-		broker:           broker,
-		timer:            time.NewTicker(5 * time.Second), // TODO this should be configurable
-		newSubscriptions: make(chan *partitionOffsetManager),
-		subscriptions:    make(map[*partitionOffsetManager]none),
+		parent:              om,
+		broker:              broker,
+		timer:               time.NewTicker(om.conf.Consumer.Offsets.CommitInterval),
+		newSubscriptions:    make(chan *partitionOffsetManager),
+		removeSubscriptions: make(chan *partitionOffsetManager),
+		flushNow:            make(chan chan none),
+		subscriptions:       make(map[*partitionOffsetManager]none),
 	}
 
 	go withRecover(bom.mainLoop)
@@ -300,16 +561,31 @@ func (bom *brokerOffsetManager) mainLoop() {
 				return
 			}
 			bom.subscriptions[s] = none{}
+		case s := <-bom.removeSubscriptions:
+			delete(bom.subscriptions, s)
+		case ack := <-bom.flushNow:
+			bom.flushToBroker()
+			close(ack)
 		}
 	}
 }
 
+// flushAndWait asks the bom's mainLoop goroutine to commit immediately and blocks until it has
+// done so, used by OffsetManager.CommitOffsets to offer a synchronous commit on top of the
+// regular CommitInterval ticker.
+func (bom *brokerOffsetManager) flushAndWait() {
+	ack := make(chan none)
+	bom.flushNow <- ack
+	<-ack
+}
+
 func (bom *brokerOffsetManager) flushToBroker() {
 	request := bom.constructRequest()
 	response, err := bom.broker.CommitOffset(request)
 
 	if err != nil {
 		bom.abort(err)
+		return
 	}
 
 	for s := range bom.subscriptions {
@@ -317,13 +593,13 @@ func (bom *brokerOffsetManager) flushToBroker() {
 		var ok bool
 
 		if response.Errors[s.topic] == nil {
-			s.handleError(ErrIncompleteResponse)
+			s.handleError(ErrIncompleteResponse, false)
 			delete(bom.subscriptions, s)
 			s.rebalance <- none{}
 			continue
 		}
 		if err, ok = response.Errors[s.topic][s.partition]; !ok {
-			s.handleError(ErrIncompleteResponse)
+			s.handleError(ErrIncompleteResponse, false)
 			delete(bom.subscriptions, s)
 			s.rebalance <- none{}
 			continue
@@ -332,38 +608,136 @@ func (bom *brokerOffsetManager) flushToBroker() {
 		switch err {
 		case ErrNoError:
 			break
+		case ErrOffsetsLoadInProgress, ErrNotCoordinatorForConsumer:
+			finalErr, ok := bom.retryCommit(s, err)
+			if ok {
+				continue
+			}
+			s.handleError(finalErr, isRetriableKError(finalErr))
+			delete(bom.subscriptions, s)
+			s.rebalance <- none{}
 		case ErrUnknownTopicOrPartition, ErrNotLeaderForPartition, ErrLeaderNotAvailable:
 			delete(bom.subscriptions, s)
 			s.rebalance <- none{}
 		default:
-			s.handleError(err)
+			s.handleError(err, false)
 			delete(bom.subscriptions, s)
 			s.rebalance <- none{}
 		}
 	}
 }
 
+// retryCommit is called, still on the bom's own goroutine, when the broker rejected a single
+// partition's commit with a transient coordinator error. It retries that one partition with a
+// bounded exponential backoff, configured the same as the rest of the client's retry policy via
+// Config.Metadata.Retry, rather than immediately forcing the partitionOffsetManager to rebalance
+// onto a new coordinator. It returns the last KError actually observed — which may be a different,
+// non-retriable error than the one the caller first saw — along with whether the commit
+// ultimately succeeded, so the caller reports the real failure instead of the stale original one.
+func (bom *brokerOffsetManager) retryCommit(s *partitionOffsetManager, lastErr KError) (KError, bool) {
+	backoff := bom.parent.conf.Metadata.Retry.Backoff
+
+	for attempt := 0; attempt < bom.parent.conf.Metadata.Retry.Max; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+
+		response, err := bom.broker.CommitOffset(bom.constructPartitionRequest(s))
+		if err != nil {
+			continue
+		}
+
+		kerr, ok := response.Errors[s.topic][s.partition]
+		if !ok {
+			continue
+		}
+
+		lastErr = kerr
+		if !isRetriableKError(kerr) {
+			return lastErr, kerr == ErrNoError
+		}
+	}
+
+	return lastErr, false
+}
+
 func (bom *brokerOffsetManager) constructRequest() *OffsetCommitRequest {
-	r := &OffsetCommitRequest{} // TODO use the right version
+	r := &OffsetCommitRequest{
+		ConsumerGroup: bom.parent.group,
+	} // TODO use the right version
+
+	if bom.parent.generationID >= 0 {
+		r.ConsumerGroupGeneration = bom.parent.generationID
+		r.ConsumerID = bom.parent.memberID
+	}
+
 	for s := range bom.subscriptions {
 		s.lock.Lock()
-		r.AddBlock(s.topic, s.partition, s.offset, 0, s.metadata)
+		r.AddBlock(s.topic, s.partition, s.offset, bom.retentionMillis(), s.metadata)
 		s.lock.Unlock()
 	}
 	return r
 }
 
+// constructPartitionRequest builds an OffsetCommitRequest for a single subscription, used by
+// retryCommit and flushPartition so a retry or a final close-time commit doesn't have to wait
+// for (or disturb) the rest of the subscriptions sharing this broker.
+func (bom *brokerOffsetManager) constructPartitionRequest(s *partitionOffsetManager) *OffsetCommitRequest {
+	r := &OffsetCommitRequest{
+		ConsumerGroup: bom.parent.group,
+	}
+
+	if bom.parent.generationID >= 0 {
+		r.ConsumerGroupGeneration = bom.parent.generationID
+		r.ConsumerID = bom.parent.memberID
+	}
+
+	s.lock.Lock()
+	r.AddBlock(s.topic, s.partition, s.offset, bom.retentionMillis(), s.metadata)
+	s.lock.Unlock()
+
+	return r
+}
+
+// flushPartition performs a best-effort, one-shot commit of a single partition's current offset,
+// used when a partitionOffsetManager is closing and needs one last commit outside of the regular
+// CommitInterval ticker.
+func (bom *brokerOffsetManager) flushPartition(s *partitionOffsetManager) {
+	response, err := bom.broker.CommitOffset(bom.constructPartitionRequest(s))
+	if err != nil {
+		s.handleError(err, false)
+		return
+	}
+
+	if response.Errors[s.topic] == nil {
+		s.handleError(ErrIncompleteResponse, false)
+		return
+	}
+
+	if kerr, ok := response.Errors[s.topic][s.partition]; !ok {
+		s.handleError(ErrIncompleteResponse, false)
+	} else if kerr != ErrNoError {
+		s.handleError(kerr, isRetriableKError(kerr))
+	}
+}
+
+func (bom *brokerOffsetManager) retentionMillis() int64 {
+	if bom.parent.conf.Consumer.Offsets.Retention <= 0 {
+		return 0
+	}
+	return int64(bom.parent.conf.Consumer.Offsets.Retention / time.Millisecond)
+}
+
 func (bom *brokerOffsetManager) abort(err error) {
 	bom.parent.abandonBroker(bom)
 	_ = bom.broker.Close() // we don't care about the error this might return, we already have one
 
 	for pom := range bom.subscriptions {
-		pom.handleError(err)
+		pom.handleError(err, true)
 		pom.rebalance <- none{}
 	}
 
 	for s := range bom.newSubscriptions {
-		s.handleError(err)
+		s.handleError(err, true)
 		s.rebalance <- none{}
 	}
-}
\ No newline at end of file
+}
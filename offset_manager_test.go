@@ -0,0 +1,34 @@
+package sarama
+
+import "testing"
+
+func TestIsRetriableKError(t *testing.T) {
+	tests := []struct {
+		kerr      KError
+		retriable bool
+	}{
+		{ErrOffsetsLoadInProgress, true},
+		{ErrNotCoordinatorForConsumer, true},
+		{ErrNoError, false},
+		{ErrUnknownTopicOrPartition, false},
+		{ErrNotLeaderForPartition, false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetriableKError(tt.kerr); got != tt.retriable {
+			t.Errorf("isRetriableKError(%v) = %v, want %v", tt.kerr, got, tt.retriable)
+		}
+	}
+}
+
+func TestOffsetManagerErrorFormatting(t *testing.T) {
+	single := &OffsetManagerError{Topic: "foo", Partition: 3, Err: ErrOffsetsLoadInProgress, Retriable: true}
+	if single.Error() == "" {
+		t.Error("expected a non-empty error message")
+	}
+
+	aggregate := OffsetManagerErrors{single, single}
+	if aggregate.Error() == "" {
+		t.Error("expected a non-empty aggregate error message")
+	}
+}
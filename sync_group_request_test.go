@@ -0,0 +1,32 @@
+package sarama
+
+import "testing"
+
+var (
+	syncGroupRequestNoAssignments = []byte{
+		0, 3, 'f', 'o', 'o', // GroupId
+		0, 0, 0, 1, // GenerationId
+		0, 2, 'm', '1', // MemberId
+		0, 0, 0, 0, // GroupAssignments: empty array
+	}
+
+	syncGroupRequestOneAssignment = []byte{
+		0, 3, 'f', 'o', 'o', // GroupId
+		0, 0, 0, 1, // GenerationId
+		0, 2, 'm', '1', // MemberId
+		0, 0, 0, 1, // GroupAssignments: one entry
+		0, 2, 'm', '1', // member id
+		0, 0, 0, 3, 0x01, 0x02, 0x03, // assignment bytes
+	}
+)
+
+func TestSyncGroupRequest(t *testing.T) {
+	request := new(SyncGroupRequest)
+	request.GroupId = "foo"
+	request.GenerationId = 1
+	request.MemberId = "m1"
+	testRequest(t, "no assignments", request, syncGroupRequestNoAssignments)
+
+	request.AddGroupAssignment("m1", []byte{0x01, 0x02, 0x03})
+	testRequest(t, "one assignment", request, syncGroupRequestOneAssignment)
+}